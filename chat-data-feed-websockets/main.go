@@ -1,48 +1,272 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"golang.org/x/net/websocket"
 )
 
+// controlMessage is the JSON control frame clients send on /ws. "subscribe"
+// and "unsubscribe" take Topic; "publish" takes Topic and Message and fans
+// Message out to every subscriber of that topic (the sender too, if it is
+// subscribed), e.g.
+// {"op":"publish","topic":"room1","message":"hi"}; "order" takes
+// Side/Price/Size and applies a mutation directly to the shared order book,
+// e.g. {"op":"order","side":"bid","price":100.5,"size":2}.
+type controlMessage struct {
+	Op      string  `json:"op"`
+	Topic   string  `json:"topic,omitempty"`
+	Message string  `json:"message,omitempty"`
+	Side    Side    `json:"side,omitempty"`
+	Price   float64 `json:"price,omitempty"`
+	Size    float64 `json:"size,omitempty"`
+}
+
+// orderbookDepth bounds how many price levels per side go out in a
+// snapshot frame.
+const orderbookDepth = 10
+
+// conn wraps a websocket connection with its own outbound queue and writer
+// goroutine. Every Publish for every topic this conn is subscribed to just
+// enqueues onto send - only writeLoop ever calls ws.Write, so concurrent
+// publishes can never interleave frames on the same socket.
+type conn struct {
+	ws   *websocket.Conn
+	send chan []byte
+}
+
+func newConn(ws *websocket.Conn) *conn {
+	return &conn{
+		ws:   ws,
+		send: make(chan []byte, 16),
+	}
+}
+
+// writeLoop drains send and writes each frame to the socket in order,
+// returning (and effectively marking the conn dead) on the first write
+// error or once send is closed.
+func (c *conn) writeLoop() {
+	for b := range c.send {
+		if _, err := c.ws.Write(b); err != nil {
+			fmt.Println("[conn] write error: ", err)
+			return
+		}
+	}
+}
+
+// Hub tracks which conns are subscribed to which topics and fans outbound
+// messages out to subscribers. Mutating topics takes the write lock;
+// Publish only ever takes a read lock, so publishes to different topics -
+// or even the same topic from different goroutines - never block each
+// other on registry access.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*conn]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*conn]struct{})}
+}
+
+// Subscribe adds c as a subscriber of topic, creating the topic if this is
+// its first subscriber.
+func (h *Hub) Subscribe(topic string, c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = make(map[*conn]struct{})
+		h.topics[topic] = subs
+	}
+
+	subs[c] = struct{}{}
+}
+
+// Unsubscribe removes c from topic, dropping the topic entirely once it
+// has no subscribers left.
+func (h *Hub) Unsubscribe(topic string, c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unsubscribeLocked(topic, c)
+}
+
+func (h *Hub) unsubscribeLocked(topic string, c *conn) {
+	subs, ok := h.topics[topic]
+	if !ok {
+		return
+	}
+
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// UnsubscribeAll removes c from every topic it's subscribed to. Called once
+// a connection dies so dead conns don't leak inside the topic maps.
+func (h *Hub) UnsubscribeAll(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for topic := range h.topics {
+		h.unsubscribeLocked(topic, c)
+	}
+}
+
+// Publish fans b out to every conn currently subscribed to topic. It never
+// touches the socket directly - it only enqueues onto each conn's send
+// channel, so a slow subscriber can't stall Publish or any other
+// subscriber. If a subscriber's queue is already full, its frame is
+// dropped rather than blocking the publisher.
+func (h *Hub) Publish(topic string, b []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c := range h.topics[topic] {
+		select {
+		case c.send <- b:
+		default:
+			fmt.Println("[hub] dropping frame for slow subscriber on topic: ", topic)
+		}
+	}
+}
+
 type Server struct {
-	conns map[*websocket.Conn]bool
+	hub  *Hub
+	book *OrderBook
+
+	obMu   sync.Mutex
+	obSubs map[*orderbookSub]struct{}
 }
 
 func NewServer() *Server {
-	return &Server{
-		conns: make(map[*websocket.Conn]bool),
+	s := &Server{
+		hub:    NewHub(),
+		book:   NewOrderBook(),
+		obSubs: make(map[*orderbookSub]struct{}),
+	}
+
+	go s.simulateOrders()
+
+	return s
+}
+
+// applyOrder applies order to the book and pushes the resulting mutation to
+// every orderbook subscriber's own coalescing buffer. Apply and the push
+// share one obMu critical section, so subscribers receive changes in seq
+// order.
+func (s *Server) applyOrder(order Order) {
+	s.obMu.Lock()
+	defer s.obMu.Unlock()
+
+	change, seq := s.book.Apply(order)
+	for sub := range s.obSubs {
+		sub.push(change, seq)
+	}
+}
+
+// subscribeOrderbook registers sub and captures a snapshot in the same
+// obMu critical section applyOrder uses, so no Apply+push can land between
+// the snapshot and the registration. That guarantees
+// sub's first delta is exactly snapshot.Seq+1, with no gap forcing an
+// immediate resync.
+func (s *Server) subscribeOrderbook(sub *orderbookSub, depth int) Snapshot {
+	s.obMu.Lock()
+	defer s.obMu.Unlock()
+
+	snapshot := s.book.Snapshot(depth)
+	s.obSubs[sub] = struct{}{}
+
+	return snapshot
+}
+
+// simulateOrders is the demo order generator: absent any real trading
+// activity, it perturbs the book on a fixed cadence so the feed always has
+// something to stream.
+func (s *Server) simulateOrders() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	const basePrice = 100.0
+	tick := 0
+
+	for range ticker.C {
+		tick++
+
+		side := SideBid
+		if tick%2 == 0 {
+			side = SideAsk
+		}
+
+		offset := float64(tick%10) * 0.5
+		price := basePrice - offset
+		if side == SideAsk {
+			price = basePrice + offset
+		}
+
+		s.applyOrder(Order{Side: side, Price: price, Size: float64(tick%5 + 1)})
 	}
 }
 
 func (s *Server) handleWSOrderBook(ws *websocket.Conn) {
 	fmt.Println("new incoming connection from client to orderbook feed: ", ws.RemoteAddr())
 
-	for {
-		payload := fmt.Sprintf("orderbook data -> %d\n", time.Now().UnixNano())
-		ws.Write([]byte(payload))
-		time.Sleep(time.Second * 2)
+	c := newConn(ws)
+	go c.writeLoop()
+
+	sub := newOrderbookSub(c)
+	snapshot := s.subscribeOrderbook(sub, orderbookDepth)
+
+	if b, err := json.Marshal(snapshot); err == nil {
+		c.send <- b
+	} else {
+		fmt.Println("[orderbook] marshal snapshot error: ", err)
 	}
+
+	stop := make(chan struct{})
+	go sub.run(stop)
+
+	s.readLoop(c)
+
+	// Wait for sub.run to actually exit, and drop c from every hub topic
+	// it subscribed to through readLoop, before closing c.send - run (via
+	// flush) and hub Publish are the only other senders on c.send, and
+	// closing it out from under a concurrent send would panic.
+	close(stop)
+	<-sub.done
+
+	s.obMu.Lock()
+	delete(s.obSubs, sub)
+	s.obMu.Unlock()
+	s.hub.UnsubscribeAll(c)
+	close(c.send)
 }
 
 func (s *Server) handleWS(ws *websocket.Conn) {
 	fmt.Println("new incoming connection from client: ", ws.RemoteAddr())
 
-	// we need to have a mutex to make sure we don't have race conditions/
-	// from now, for this simple app we are not going to implement that
-	s.conns[ws] = true
+	c := newConn(ws)
+	go c.writeLoop()
+
+	s.readLoop(c)
 
-	s.readLoop(ws)
+	s.hub.UnsubscribeAll(c)
+	close(c.send)
 }
 
-func (s *Server) readLoop(ws *websocket.Conn) {
+// readLoop decodes JSON control frames off ws and routes them through the
+// hub until the connection closes.
+func (s *Server) readLoop(c *conn) {
 	buf := make([]byte, 1024)
 	for {
-		n, err := ws.Read((buf))
+		n, err := c.ws.Read(buf)
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -51,20 +275,24 @@ func (s *Server) readLoop(ws *websocket.Conn) {
 			continue
 		}
 
-		msg := buf[:n]
-		// fmt.Println("message received:", string(msg))
-		// ws.Write([]byte("thank you for the msg!!!"))
-		s.broadcast(msg)
-	}
-}
+		var msg controlMessage
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			fmt.Println("[readLoop] invalid control frame: ", err)
+			continue
+		}
 
-func (s *Server) broadcast(b []byte) {
-	for ws := range s.conns {
-		go func(ws *websocket.Conn) {
-			if _, err := ws.Write(b); err != nil {
-				fmt.Println("[broadcast] error to write: ", err)
-			}
-		}(ws)
+		switch msg.Op {
+		case "subscribe":
+			s.hub.Subscribe(msg.Topic, c)
+		case "unsubscribe":
+			s.hub.Unsubscribe(msg.Topic, c)
+		case "publish":
+			s.hub.Publish(msg.Topic, []byte(msg.Message))
+		case "order":
+			s.applyOrder(Order{Side: msg.Side, Price: msg.Price, Size: msg.Size})
+		default:
+			fmt.Println("[readLoop] unknown op: ", msg.Op)
+		}
 	}
 }
 
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/emirpasic/gods/maps/treemap"
+	"github.com/emirpasic/gods/utils"
+)
+
+// Side identifies which side of the book an order or price level belongs to.
+type Side string
+
+const (
+	SideBid Side = "bid"
+	SideAsk Side = "ask"
+)
+
+// Order is one incoming mutation to the book: set the size resting at
+// Price on Side, or remove that price level entirely when Size is zero.
+type Order struct {
+	Side  Side
+	Price float64
+	Size  float64
+}
+
+// PriceLevel is one row of a snapshot: a price and the total size resting
+// there.
+type PriceLevel struct {
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+// Snapshot is the full state of the book, down to depth levels per side, as
+// sent to a client right after it subscribes.
+type Snapshot struct {
+	Type string       `json:"type"`
+	Seq  uint64       `json:"seq"`
+	Bids []PriceLevel `json:"bids"`
+	Asks []PriceLevel `json:"asks"`
+}
+
+// Change is one line of a delta frame: the side, price, and new size at
+// that price - a size of zero means the level was removed.
+type Change struct {
+	Side  Side    `json:"side"`
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+// Delta is streamed to subscribers whenever the book mutates. A subscriber
+// can fall behind the book's mutation rate, in which case orderbookSub
+// coalesces several mutations into one Delta - so FromSeq and Seq span a
+// range of individual mutation seqs rather than naming a single one, and
+// Changes holds only the latest size per price level touched in that
+// range. Clients reconstruct state by applying Changes in order, and
+// resync from a fresh snapshot if they ever see a gap (FromSeq !=
+// lastSeq+1, where lastSeq is the previous Delta's Seq, or the snapshot's
+// Seq for the first Delta received).
+type Delta struct {
+	Type    string   `json:"type"`
+	FromSeq uint64   `json:"fromSeq"`
+	Seq     uint64   `json:"seq"`
+	Changes []Change `json:"changes"`
+}
+
+// descendingFloat64Comparator orders highest price first, so the bid side
+// yields its best price as the first entry during iteration.
+func descendingFloat64Comparator(a, b interface{}) int {
+	return -utils.Float64Comparator(a, b)
+}
+
+// OrderBook is an L2 (price-aggregated) order book: one treemap per side,
+// keyed by price, holding the total size resting at that price.
+type OrderBook struct {
+	mu   sync.RWMutex
+	bids *treemap.Map
+	asks *treemap.Map
+	seq  uint64
+}
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{
+		bids: treemap.NewWith(descendingFloat64Comparator),
+		asks: treemap.NewWith(utils.Float64Comparator),
+	}
+}
+
+func (ob *OrderBook) sideMap(side Side) *treemap.Map {
+	if side == SideBid {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// Apply mutates the book with order and returns the resulting Change along
+// with the sequence number it's tagged with.
+func (ob *OrderBook) Apply(order Order) (Change, uint64) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	side := ob.sideMap(order.Side)
+	if order.Size <= 0 {
+		side.Remove(order.Price)
+		order.Size = 0
+	} else {
+		side.Put(order.Price, order.Size)
+	}
+
+	ob.seq++
+
+	return Change{Side: order.Side, Price: order.Price, Size: order.Size}, ob.seq
+}
+
+// Snapshot returns the top depth price levels per side, tagged with the
+// sequence number they're consistent as-of. A client that applies only
+// deltas with Seq greater than this value stays in sync.
+func (ob *OrderBook) Snapshot(depth int) Snapshot {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	return Snapshot{
+		Type: "snapshot",
+		Seq:  ob.seq,
+		Bids: topLevels(ob.bids, depth),
+		Asks: topLevels(ob.asks, depth),
+	}
+}
+
+func topLevels(m *treemap.Map, depth int) []PriceLevel {
+	var out []PriceLevel
+
+	it := m.Iterator()
+	for it.Next() && len(out) < depth {
+		out = append(out, PriceLevel{
+			Price: it.Key().(float64),
+			Size:  it.Value().(float64),
+		})
+	}
+
+	return out
+}
+
+// priceLevelKey identifies one (side, price) level for coalescing purposes.
+type priceLevelKey struct {
+	side  Side
+	price float64
+}
+
+// orderbookSub is one subscriber's outbound state for the orderbook feed:
+// a coalescing buffer plus the goroutine that flushes it. When the
+// underlying conn falls behind, new changes are merged into the buffer
+// (last write per price level wins) instead of growing an unbounded queue
+// of individual delta frames.
+type orderbookSub struct {
+	c *conn
+
+	mu      sync.Mutex
+	pending map[priceLevelKey]Change
+	fromSeq uint64
+	seq     uint64
+	dirty   bool
+
+	notify chan struct{}
+	done   chan struct{}
+}
+
+func newOrderbookSub(c *conn) *orderbookSub {
+	return &orderbookSub{
+		c:       c,
+		pending: make(map[priceLevelKey]Change),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// push merges change into the coalescing buffer and wakes the flush loop.
+// If a change for the same price level is already pending, it's replaced -
+// only the latest size at each level matters to a client resyncing from
+// deltas. seq is recorded as fromSeq the moment the buffer goes from empty
+// to non-empty, so the eventual flush's [fromSeq,seq] range spans every
+// individual mutation coalesced into it, even though duplicate price
+// levels collapse to one Change entry.
+func (s *orderbookSub) push(change Change, seq uint64) {
+	s.mu.Lock()
+	if !s.dirty {
+		s.fromSeq = seq
+	}
+	s.pending[priceLevelKey{change.Side, change.Price}] = change
+	s.seq = seq
+	s.dirty = true
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+		// a flush is already pending wake-up; this change will ride along
+	}
+}
+
+// run flushes the coalescing buffer to the underlying conn until stop
+// fires, then closes done so a caller can be sure no further send on
+// s.c.send will happen before it closes that channel itself.
+func (s *orderbookSub) run(stop <-chan struct{}) {
+	defer close(s.done)
+
+	for {
+		select {
+		case <-s.notify:
+			s.flush(stop)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// flush sends everything accumulated since the last flush as a single
+// delta frame. If the conn's send buffer is full, flush blocks until the
+// writer drains it (or stop fires) instead of re-queuing the changes and
+// re-signaling notify - that would spin run in a tight loop against a slow
+// conn instead of actually applying backpressure.
+func (s *orderbookSub) flush(stop <-chan struct{}) {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+
+	changes := make([]Change, 0, len(s.pending))
+	for _, change := range s.pending {
+		changes = append(changes, change)
+	}
+	fromSeq := s.fromSeq
+	seq := s.seq
+	s.pending = make(map[priceLevelKey]Change)
+	s.dirty = false
+	s.mu.Unlock()
+
+	b, err := json.Marshal(Delta{Type: "delta", FromSeq: fromSeq, Seq: seq, Changes: changes})
+	if err != nil {
+		fmt.Println("[orderbook] marshal delta error: ", err)
+		return
+	}
+
+	select {
+	case s.c.send <- b:
+	case <-stop:
+	}
+}
@@ -1,15 +1,32 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
-	_ "net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
-	_ "sync"
+	"sync/atomic"
 	"time"
-	_ "time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/time/rate"
 )
 
+// ErrDisallowed is returned by scrapeURL when a page's robots.txt forbids
+// us from fetching it, so callers can tell that case apart from a network
+// or server error.
+var ErrDisallowed = errors.New("scrape: disallowed by robots.txt")
+
 // ScrapeResult holds all the information from scraping a single URL
 // Using a struct allow us to pass around all related data as one unit
 // This is especially important for concurrent programming where we need to
@@ -20,29 +37,341 @@ type ScrapeResult struct {
 	ContentLength int64         // size of response body in bytes (-1 if unknown)
 	Duration      time.Duration // How long the request took
 	Error         error         // Any error that occurred (nil if successful)
+	Depth         int           // How many hops away from the seed URLs this page is
+	Discovered    []string      // Links found on the page that passed the crawl filters
+}
+
+// visited tracks every URL we've already queued or scraped so the crawler
+// never processes the same page twice, even with multiple workers racing
+// to enqueue the same link at the same time.
+type visited struct {
+	m map[string]struct{}
+	sync.Mutex
+}
+
+func newVisited() *visited {
+	return &visited{m: make(map[string]struct{})}
+}
+
+// Set marks url as seen and reports whether it was newly added.
+// Returning false for an already-seen URL lets callers skip it with a
+// single call instead of a separate check-then-set (which would race).
+func (v *visited) Set(url string) bool {
+	v.Lock()
+	defer v.Unlock()
+
+	if _, ok := v.m[url]; ok {
+		return false
+	}
+
+	v.m[url] = struct{}{}
+	return true
+}
+
+// crawlLimits bounds how far and how wide the crawl is allowed to go, so a
+// pathological site (infinite redirect chain, link farm, etc) can't keep
+// the crawler running forever.
+type crawlLimits struct {
+	maxDepth     int
+	maxPages     int32
+	allowedHosts []string
+}
+
+// hostAllowed reports whether host is in the allow-list. An empty
+// allow-list means every host is allowed.
+func (c crawlLimits) hostAllowed(host string) bool {
+	if len(c.allowedHosts) == 0 {
+		return true
+	}
+
+	for _, allowed := range c.allowedHosts {
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ScraperConfig holds the knobs that apply to every worker in the pool:
+// how hard we're allowed to hit a single host, what we identify ourselves
+// as, and whether we honor robots.txt at all.
+type ScraperConfig struct {
+	PerHostRPS     float64
+	Burst          int
+	UserAgent      string
+	ObeyRobots     bool
+	RequestTimeout time.Duration
+}
+
+// defaultScraperConfig returns conservative defaults: one request per
+// second per host, obeying robots.txt, with a per-request timeout well
+// under typical crawl deadlines.
+func defaultScraperConfig() ScraperConfig {
+	return ScraperConfig{
+		PerHostRPS:     1,
+		Burst:          1,
+		UserAgent:      "go-lang-projects-scraper/1.0",
+		ObeyRobots:     true,
+		RequestTimeout: 5 * time.Second,
+	}
+}
+
+// HostLimiter hands out a token-bucket rate.Limiter per host so the worker
+// pool never hammers a single domain even when numWorkers is high - each
+// host gets its own independent budget instead of sharing one global one.
+type HostLimiter struct {
+	limits     map[string]*rate.Limiter
+	defaultRPS float64
+	burst      int
+	mu         sync.Mutex
+}
+
+func newHostLimiter(defaultRPS float64, burst int) *HostLimiter {
+	return &HostLimiter{
+		limits:     make(map[string]*rate.Limiter),
+		defaultRPS: defaultRPS,
+		burst:      burst,
+	}
+}
+
+// limiterFor returns the limiter for host, creating one on first use.
+func (h *HostLimiter) limiterFor(host string) *rate.Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	limiter, ok := h.limits[host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(h.defaultRPS), h.burst)
+		h.limits[host] = limiter
+	}
+
+	return limiter
+}
+
+// Wait blocks until host's bucket has a token to spend, or returns early
+// if ctx is canceled first.
+func (h *HostLimiter) Wait(ctx context.Context, host string) error {
+	return h.limiterFor(host).Wait(ctx)
+}
+
+// robotsRules holds the Disallow prefixes that apply to us for one host.
+// A zero-value robotsRules allows everything.
+type robotsRules struct {
+	disallow []string
+}
+
+// allows reports whether path is permitted under these rules.
+func (r robotsRules) allows(path string) bool {
+	for _, prefix := range r.disallow {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseRobots implements just enough of the robots.txt format to cover the
+// common case: a single "User-agent: *" group with Disallow lines. Other
+// directives (Allow, Crawl-delay, Sitemap, per-agent groups) are ignored.
+func parseRobots(body io.Reader) robotsRules {
+	var rules robotsRules
+	appliesToUs := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			appliesToUs = value == "*"
+		case "disallow":
+			if appliesToUs && value != "" {
+				rules.disallow = append(rules.disallow, value)
+			}
+		}
+	}
+
+	return rules
+}
+
+// RobotsCache fetches and parses /robots.txt for a host the first time we
+// contact it, then reuses the parsed rules for every later request to that
+// host so we don't refetch robots.txt per page.
+type RobotsCache struct {
+	userAgent string
+	client    *http.Client
+	mu        sync.Mutex
+	rules     map[string]robotsRules
+}
+
+func newRobotsCache(userAgent string, client *http.Client) *RobotsCache {
+	return &RobotsCache{
+		userAgent: userAgent,
+		client:    client,
+		rules:     make(map[string]robotsRules),
+	}
+}
+
+// Allowed reports whether rawURL may be fetched. ctx bounds the robots.txt
+// fetch itself (when one is needed) so a hanging robots.txt endpoint can't
+// block a worker past the caller's deadline. Hosts we can't reach robots.txt
+// for are treated as allowing everything, matching the permissive default
+// most crawlers fall back to.
+func (r *RobotsCache) Allowed(ctx context.Context, rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+
+	r.mu.Lock()
+	rules, ok := r.rules[parsed.Host]
+	r.mu.Unlock()
+
+	if !ok {
+		rules = r.fetch(ctx, parsed)
+
+		r.mu.Lock()
+		r.rules[parsed.Host] = rules
+		r.mu.Unlock()
+	}
+
+	return rules.allows(parsed.Path)
+}
+
+func (r *RobotsCache) fetch(ctx context.Context, parsed *url.URL) robotsRules {
+	robotsURL := fmt.Sprintf("%s://%s/robots.txt", parsed.Scheme, parsed.Host)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return robotsRules{}
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return robotsRules{}
+	}
+
+	return parseRobots(resp.Body)
+}
+
+// extractLinks parses an HTML document body and returns every <a href>
+// target, normalized into absolute URLs against base. Malformed or
+// relative-only hrefs that can't be resolved are skipped rather than
+// failing the whole page.
+func extractLinks(base *url.URL, body io.Reader) []string {
+	var links []string
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// io.EOF is the normal "done parsing" signal from the tokenizer
+			return links
+		}
+
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		if token.Data != "a" {
+			continue
+		}
+
+		for _, attr := range token.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+
+			resolved, err := base.Parse(attr.Val)
+			if err != nil {
+				continue
+			}
+
+			links = append(links, resolved.String())
+		}
+	}
 }
 
 // scrapeURL takes a URL a returns basic information about the response
 // this demonstrates basic HTTP client usage and error handling patters in go
 // This will return a ScrapedResult struct, this makes the function more flexible - called can decide what to do with results
 // Return structured data is essential for concurrent processing
-func scrapeURL(url string) ScrapeResult {
+func scrapeURL(ctx context.Context, rawURL string, depth int, limits crawlLimits, cfg ScraperConfig, hostLimiter *HostLimiter, robots *RobotsCache) ScrapeResult {
 	// time.Now() captures the current timestamp - we'll use this to measure
 	// how long the HTTP request takes (useful for performance analysis)
 	start := time.Now()
 
-	// http.Get() makes an HTTP Get request and returns two values:
-	// 1. *http.Response (the response object)
-	// 2. error (nil if successful, error object if something went wrong)
-	// this is Go's standard error handling patter - always check the error!
-	resp, err := http.Get(url)
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
+		return ScrapeResult{URL: rawURL, Duration: time.Since(start), Error: err, Depth: depth}
+	}
+
+	// Derive a per-request timeout from the parent (crawl-wide) context up
+	// front, so it also bounds the robots.txt fetch below - otherwise a
+	// hanging robots.txt endpoint would block this worker past both
+	// cfg.RequestTimeout and the global crawl deadline.
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+	defer cancel()
+
+	// Robots.txt is checked before we even touch the rate limiter - a
+	// disallowed page shouldn't spend part of the host's request budget.
+	if cfg.ObeyRobots && !robots.Allowed(reqCtx, rawURL) {
+		return ScrapeResult{URL: rawURL, Duration: time.Since(start), Error: ErrDisallowed, Depth: depth}
+	}
+
+	if err := hostLimiter.Wait(reqCtx, parsed.Host); err != nil {
+		return ScrapeResult{URL: rawURL, Duration: time.Since(start), Error: err, Depth: depth}
+	}
+
+	// Restart the clock once the rate limiter lets us through, so Duration
+	// measures the HTTP request itself rather than time spent queued for a
+	// token.
+	start = time.Now()
+
+	// http.NewRequestWithContext (instead of http.Get) so we can attach a
+	// User-Agent header and bind the request to reqCtx - canceling reqCtx
+	// aborts the in-flight request instead of leaving it to run to completion.
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return ScrapeResult{URL: rawURL, Duration: time.Since(start), Error: err, Depth: depth}
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// reqCtx.Err() distinguishes "we gave up waiting" from an ordinary
+		// network error (connection refused, DNS failure, etc).
+		resultErr := err
+		if reqCtx.Err() != nil {
+			resultErr = reqCtx.Err()
+		}
+
 		// If there's an error, return a result struct with the error
 		// Notice we calculate duration even for failed requests
 		return ScrapeResult{
-			URL:      url,
+			URL:      rawURL,
 			Duration: time.Since(start),
-			Error:    err,
+			Error:    resultErr,
+			Depth:    depth,
 			// StatusCode and ContentLength will be zero values (0, 0)
 		}
 	}
@@ -53,96 +382,443 @@ func scrapeURL(url string) ScrapeResult {
 	// defer is perfect here because it guarantees cleanup even if we return early
 	defer resp.Body.Close()
 
-	// Print comprehensive information about the http response:
-	// - StatusCode: HTTP status (200=ok, 404=not-found, 500=Server Error, etc.)
-	// - ContentLength: size of the response body in bytes (-1 if unknown)
-	// - duration: how long the request took (useful for performance comparison)
-	// fmt.Printf("URL: %s | status: %d | Length: %d bytes | Time: %v\n",
-	// 	url, resp.StatusCode, resp.ContentLength, duration)
-
-	return ScrapeResult{
-		URL:           url,
+	result := ScrapeResult{
+		URL:           rawURL,
 		StatusCode:    resp.StatusCode,
 		ContentLength: resp.ContentLength,
 		// time.Since() calculates the elapsed time from start until now
 		// this measures the total time for the HTTP request (network + server processing)
 		Duration: time.Since(start),
 		Error:    nil, // Explicitly set to nil to show success
+		Depth:    depth,
 	}
 
+	// Only bother extracting links if we're allowed to go one level deeper -
+	// no point parsing the body just to throw the links away.
+	if depth < limits.maxDepth {
+		for _, link := range extractLinks(parsed, resp.Body) {
+			linkHost, err := url.Parse(link)
+			if err != nil || !limits.hostAllowed(linkHost.Host) {
+				continue
+			}
+
+			result.Discovered = append(result.Discovered, link)
+		}
+	}
+
+	return result
+}
+
+// Sink receives scrape results as they're produced. Pulling this out of
+// resultCollector means the crawl's output isn't hard-wired to stdout -
+// a caller can fan results out to a file, a database, or (via MemorySink)
+// back into the program, all without touching the collector itself.
+type Sink interface {
+	Write(ScrapeResult) error
+	Close() error
+}
+
+// StdoutSink prints each result to stdout as it arrives, in the format the
+// collector used to print inline, extended with the page's depth and (on
+// success) how many links it contributed.
+type StdoutSink struct {
+	count int
+}
+
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{}
 }
 
-// printResult displays a ScrapeResult in a readable format
-// Separating display logic from scraping Logic follows good design principles
-func printResult(result ScrapeResult) {
+func (s *StdoutSink) Write(result ScrapeResult) error {
+	s.count++
+	fmt.Printf("[%d] ", s.count)
+
 	if result.Error != nil {
-		// Handle error case - show URL and error message
-		fmt.Printf("ERROR - URL: %s | Error: %v | Time: %v\n",
-			result.URL, result.Error, result.Duration)
+		fmt.Printf("ERROR - URL: %s | Depth: %d | Error: %v | Time: %v\n",
+			result.URL, result.Depth, result.Error, result.Duration)
 	} else {
-		// Handle success case - show all details
-		fmt.Printf("SUCCESS - URL:%s | Status: %d | Length: %d bytes | Time: %v\n",
-			result.URL, result.StatusCode, result.ContentLength, result.Duration)
+		fmt.Printf("SUCCESS - URL:%s | Depth: %d | Status: %d | Length: %d bytes | Links: %d | Time: %v\n",
+			result.URL, result.Depth, result.StatusCode, result.ContentLength, len(result.Discovered), result.Duration)
+	}
+
+	return nil
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
+
+// MemorySink accumulates every result it sees, in arrival order. It's the
+// "in-memory sink" resultCollector looks for when deciding what (if
+// anything) to hand back on done - sinks that write elsewhere (stdout,
+// files) have nothing to return to the caller.
+type MemorySink struct {
+	mu      sync.Mutex
+	results []ScrapeResult
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(result ScrapeResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result)
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Results returns a copy of everything collected so far.
+func (s *MemorySink) Results() []ScrapeResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]ScrapeResult, len(s.results))
+	copy(out, s.results)
+	return out
+}
+
+// statsSink accumulates just the handful of aggregate numbers main's
+// end-of-run summary needs (count, success count, total processing time)
+// rather than every ScrapeResult. It's always part of the sink chain, so
+// the summary stays available even on a large crawl where the user didn't
+// ask for (and doesn't want the memory cost of) a full MemorySink.
+type statsSink struct {
+	mu                  sync.Mutex
+	count               int
+	successCount        int
+	totalProcessingTime time.Duration
+}
+
+func newStatsSink() *statsSink {
+	return &statsSink{}
+}
+
+func (s *statsSink) Write(result ScrapeResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	if result.Error == nil {
+		s.successCount++
+	}
+	s.totalProcessingTime += result.Duration
+
+	return nil
+}
+
+func (s *statsSink) Close() error {
+	return nil
+}
+
+// snapshot returns the current aggregate counts.
+func (s *statsSink) snapshot() (count, successCount int, totalProcessingTime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count, s.successCount, s.totalProcessingTime
+}
+
+// errString renders a ScrapeResult's Error as a plain string for formats
+// (JSON, CSV) that can't carry a Go error value directly.
+func errString(result ScrapeResult) string {
+	if result.Error == nil {
+		return ""
+	}
+
+	return result.Error.Error()
+}
+
+// jsonResult is the JSONL-friendly projection of a ScrapeResult - the
+// same fields, but with Duration and Error in serializable form.
+type jsonResult struct {
+	URL           string   `json:"url"`
+	StatusCode    int      `json:"status_code"`
+	ContentLength int64    `json:"content_length"`
+	DurationMS    int64    `json:"duration_ms"`
+	Error         string   `json:"error,omitempty"`
+	Depth         int      `json:"depth"`
+	Discovered    []string `json:"discovered,omitempty"`
+}
+
+func toJSONResult(result ScrapeResult) jsonResult {
+	return jsonResult{
+		URL:           result.URL,
+		StatusCode:    result.StatusCode,
+		ContentLength: result.ContentLength,
+		DurationMS:    result.Duration.Milliseconds(),
+		Error:         errString(result),
+		Depth:         result.Depth,
+		Discovered:    result.Discovered,
+	}
+}
+
+// JSONLSink writes one ScrapeResult per line as JSON (the "JSON Lines"
+// format), so downstream tools can stream-process a crawl's output as it's
+// produced instead of waiting for the whole run to finish.
+type JSONLSink struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONLSink{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (s *JSONLSink) Write(result ScrapeResult) error {
+	return s.encoder.Encode(toJSONResult(result))
+}
+
+func (s *JSONLSink) Close() error {
+	return s.file.Close()
+}
+
+// CSVSink writes results as CSV rows under a fixed header.
+type CSVSink struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func NewCSVSink(path string) (*CSVSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"url", "status", "length", "duration_ms", "error"}); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &CSVSink{file: file, writer: writer}, nil
+}
+
+func (s *CSVSink) Write(result ScrapeResult) error {
+	row := []string{
+		result.URL,
+		strconv.Itoa(result.StatusCode),
+		strconv.FormatInt(result.ContentLength, 10),
+		strconv.FormatInt(result.Duration.Milliseconds(), 10),
+		errString(result),
+	}
+
+	if err := s.writer.Write(row); err != nil {
+		return err
+	}
+
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+func (s *CSVSink) Close() error {
+	s.writer.Flush()
+	return s.file.Close()
+}
+
+// buildSinks parses a -output flag value like
+// "stdout,jsonl:results.jsonl,csv:results.csv,memory" into a sink chain. A
+// statsSink is always included, since main's end-of-run summary only needs
+// a handful of aggregate numbers - the full MemorySink (every ScrapeResult,
+// kept for the life of the crawl) is opt-in via the "memory" entry, so a
+// large crawl that only asked for csv:/jsonl: output doesn't pay for it.
+func buildSinks(spec string) ([]Sink, *statsSink, error) {
+	stats := newStatsSink()
+	sinks := []Sink{stats}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, path, _ := strings.Cut(entry, ":")
+
+		switch kind {
+		case "stdout":
+			sinks = append(sinks, NewStdoutSink())
+		case "memory":
+			sinks = append(sinks, NewMemorySink())
+		case "jsonl":
+			sink, err := NewJSONLSink(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("jsonl sink %q: %w", path, err)
+			}
+			sinks = append(sinks, sink)
+		case "csv":
+			sink, err := NewCSVSink(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("csv sink %q: %w", path, err)
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, nil, fmt.Errorf("unknown sink type %q", kind)
+		}
+	}
+
+	return sinks, stats, nil
+}
+
+func closeSinks(sinks []Sink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			fmt.Printf("sink close error: %v\n", err)
+		}
 	}
 }
 
+// crawlURL pairs a URL with how deep into the crawl it was discovered, so
+// the worker pool can enforce maxDepth without threading extra channels.
+type crawlURL struct {
+	url   string
+	depth int
+}
+
 // worker is a goroutine that processes URLs from urlChannel and sends results to resultChannel
 // This is the core of the worker pool pattern - multiple workers can run this function concurrently
 // Each worker operates independently but shares the same input and output channels
-func worker(id int, urlChannel <-chan string, resultChannel chan<- ScrapeResult, wg *sync.WaitGroup) {
+//
+// Because scraping a page can discover new URLs, a worker both consumes from
+// urlChannel and produces back into it. pending tracks outstanding
+// (queued-but-not-yet-scraped) URLs so the coordinator knows when it's
+// finally safe to close urlChannel - closing it from the feeder side, as
+// before, would race with workers still trying to enqueue discovered links.
+func worker(ctx context.Context, id int, urlChannel chan crawlURL, resultChannel chan<- ScrapeResult, seen *visited, limits crawlLimits, cfg ScraperConfig, hostLimiter *HostLimiter, robots *RobotsCache, pending *sync.WaitGroup, pagesScraped *int32, wg *sync.WaitGroup) {
 	// sync.WaitGroup is used to wait for a collection of goroutines to finish
 	// defer wg.Done() ensures we signal completion even if the function exits early
 	// This is crucial for preventing deadlocks in the shutdown sequence
 
 	defer wg.Done()
 
-	// Channel direction annotations:
-	// <-chan string means "receive-only channel" - this worker can only read URLS
-	// chan<- ScrapeResult means "Send only channel" - this worker can only send results
-	// THis prevents accidentally channels in the wrong direction
+	// Channel direction annotations don't apply here anymore: workers need to
+	// both read discovered URLs out of urlChannel and write new ones back in,
+	// so the channel is bidirectional.
 	fmt.Printf("Worker %d started\n", id)
 
-	// Keep reading URLs from the channel until it's closed
-	// This loop will process URLs as they become available
-	// Multiple workers can compete for URLs from the same channel (fan-out pattern)
-	for url := range urlChannel {
-		fmt.Printf("Worker %d processing: %s\n", id, url)
+	for {
+		// select lets the worker stop pulling new URLs the moment the crawl
+		// deadline fires, instead of only noticing ctx.Done() on the next
+		// scrapeURL call.
+		var cu crawlURL
+		var ok bool
+		select {
+		case cu, ok = <-urlChannel:
+			if !ok {
+				fmt.Printf("Worker %d finished - no more URLs\n", id)
+				return
+			}
+		case <-ctx.Done():
+			fmt.Printf("Worker %d stopping - crawl deadline reached\n", id)
+			return
+		}
+
+		fmt.Printf("Worker %d processing (depth %d): %s\n", id, cu.depth, cu.url)
 
-		// Scrape the URL (this is the time-consuming operation)
-		result := scrapeURL(url)
+		// Claim a slot under the page cap before scraping, so URLs still
+		// queued once maxPages is reached are drained without being fetched.
+		if atomic.AddInt32(pagesScraped, 1) > limits.maxPages {
+			pending.Done()
+			continue
+		}
+
+		result := scrapeURL(ctx, cu.url, cu.depth, limits, cfg, hostLimiter, robots)
 
 		// Send the result to the result channel
-		// Other goroutines can receive these results (fan-in pattern)
-		resultChannel <- result
+		// Other goroutines can receive these results (fan-in pattern). Also
+		// race against ctx so a collector that already stopped (deadline
+		// reached) can't leave us blocked here forever.
+		select {
+		case resultChannel <- result:
+		case <-ctx.Done():
+			pending.Done()
+			return
+		}
 
-		fmt.Printf("Worker %d finished: %s\n", id, url)
-	}
+		// Queue newly discovered links that haven't been visited yet and
+		// still fit within the page cap. Each enqueue bumps pending before
+		// the URL is fed back into the channel, and the matching Done()
+		// below accounts for the URL we just finished. The send itself runs
+		// in its own goroutine, so a full urlChannel never blocks this
+		// worker (with every worker blocked sending, nobody would read).
+		for _, link := range result.Discovered {
+			if atomic.LoadInt32(pagesScraped) >= limits.maxPages {
+				break
+			}
+
+			if !seen.Set(link) {
+				continue
+			}
+
+			pending.Add(1)
+			go func(next crawlURL) {
+				select {
+				case urlChannel <- next:
+				case <-ctx.Done():
+					pending.Done()
+				}
+			}(crawlURL{url: link, depth: cu.depth + 1})
+		}
+
+		pending.Done()
 
-	fmt.Printf("Worker %d finished - no more URLs\n", id)
+		fmt.Printf("Worker %d finished: %s\n", id, cu.url)
+	}
 }
 
-// resultCollector is a dedicated goroutine for collecting and processing results
-// this separates the concern of result collection from the main application logic
-// It also allows for more sophisticated result processing (sorting, filtering, etc)
-func resultCollector(resultChannel <-chan ScrapeResult, wg *sync.WaitGroup, done chan<- []ScrapeResult) {
+// resultCollector is a dedicated goroutine for fanning scrape results out to
+// every configured sink. This separates the concern of result distribution
+// from the main application logic and from any single sink's format.
+func resultCollector(ctx context.Context, resultChannel <-chan ScrapeResult, sinks []Sink, done chan<- []ScrapeResult) {
 	fmt.Println("Result collector started")
 
-	var results []ScrapeResult
 	resultCount := 0
 
-	// Collect results until the channel is closed
-	// Using range automatically handles channel closing - loop exists when channel closes
-	// This is much cleaner that counting expected results manually
-	for result := range resultChannel {
-		resultCount++
-		results = append(results, result)
-
-		// Display result immediately as it arrives
-		fmt.Printf("[%d] ", resultCount)
-		printResult(result)
+	// Collect results until the channel is closed or the crawl deadline
+	// fires - whichever happens first. Once ctx is done, workers are
+	// winding down on their own, so we stop waiting and report what we have.
+collect:
+	for {
+		select {
+		case result, ok := <-resultChannel:
+			if !ok {
+				break collect
+			}
+
+			resultCount++
+			for _, sink := range sinks {
+				if err := sink.Write(result); err != nil {
+					fmt.Printf("sink write error: %v\n", err)
+				}
+			}
+		case <-ctx.Done():
+			fmt.Println("Result collector stopping - crawl deadline reached")
+			break collect
+		}
 	}
 
-	fmt.Printf("Result collector finished - collected %d results\n", len(results))
+	fmt.Printf("Result collector finished - collected %d results\n", resultCount)
+
+	// Only a MemorySink has anything to hand back to main; every other
+	// sink (including statsSink) already persisted its own copy of the
+	// data, or - for statsSink - only ever needed the aggregate counts
+	// main reads separately via its snapshot.
+	var results []ScrapeResult
+	for _, sink := range sinks {
+		if memSink, ok := sink.(*MemorySink); ok {
+			results = memSink.Results()
+			break
+		}
+	}
 
 	// send the complete results back to the main goroutine
 	// this allows main to continue summary processing
@@ -150,9 +826,22 @@ func resultCollector(resultChannel <-chan ScrapeResult, wg *sync.WaitGroup, done
 }
 
 func main() {
+	// -output takes a comma-separated list of "kind" or "kind:path" entries,
+	// e.g. "-output=stdout,jsonl:results.jsonl,csv:results.csv", so the
+	// crawl can feed a JSON Lines file and a CSV file at the same time.
+	outputFlag := flag.String("output", "stdout", "comma-separated sinks: stdout, jsonl:<path>, csv:<path>, memory")
+	flag.Parse()
+
+	sinks, stats, err := buildSinks(*outputFlag)
+	if err != nil {
+		fmt.Printf("invalid -output flag: %v\n", err)
+		os.Exit(1)
+	}
+	defer closeSinks(sinks)
+
 	fmt.Println("Web scraper starting...")
 
-	// Create a slice (dynamic array) of URLs to scrape
+	// Create a slice (dynamic array) of seed URLs to crawl from
 	// Using httpbin.org endpoints with different delays to simulate real-world variety
 	// httpbin.org/delay/N waits N seconds before responding - perfect for testing
 	urls := []string{
@@ -174,11 +863,29 @@ func main() {
 	numWorkers := 4
 	fmt.Printf("Starting worker pool with %d workers\n", numWorkers)
 
+	limits := crawlLimits{
+		maxDepth:     2,
+		maxPages:     50,
+		allowedHosts: []string{"httpbin.org"},
+	}
+
+	cfg := defaultScraperConfig()
+	hostLimiter := newHostLimiter(cfg.PerHostRPS, cfg.Burst)
+	robots := newRobotsCache(cfg.UserAgent, http.DefaultClient)
+
+	// The whole crawl gets one deadline, independent of cfg.RequestTimeout:
+	// a crawl with many slow pages should still stop on time even though no
+	// single request ever times out on its own.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(30*time.Second))
+	defer cancel()
+
 	// Create a channel to pass URLs between goroutines
-	// make(chan string) creates a channel that can send/receive strings
+	// make(chan crawlURL) creates a channel that can send/receive crawl targets
 	// Channels are Go's way of communicating between goroutines - "Don't communicate by sharing memory; share memory by communicating"
-	// THis is an unbuffered channel - sends block until someone receives
-	urlChannel := make(chan string)
+	// This channel is buffered so most discovered links are handed over
+	// without a waiting send; workers enqueue from separate goroutines, so a
+	// full buffer never deadlocks them.
+	urlChannel := make(chan crawlURL, numWorkers*4)
 
 	// Create a channel to collect results
 	// This channel will carry ScrapeResult structs from workers back to main
@@ -192,38 +899,41 @@ func main() {
 	// This ensures we don't exit before all workers have finished their cleanup
 	var wg sync.WaitGroup
 
+	// pending tracks outstanding (queued-but-not-scraped) URLs across the
+	// whole crawl. Unlike wg (which tracks live workers), pending hits zero
+	// exactly when there is no more work left to do, which is the signal
+	// the coordinator needs to safely close urlChannel.
+	var pending sync.WaitGroup
+
+	seen := newVisited()
+	var pagesScraped int32
+
 	// Record start time for the entire scarping operation
 	// This will help us measure total time for sequential processing
 	totalStart := time.Now()
 
+	// Seed the crawl: mark each starting URL as visited and queue it at
+	// depth 0, bumping pending once per URL just like a worker would.
+	pending.Add(len(urls))
 	go func() {
-		// THis is an anonymous function (lambda) that runs in its own goroutine
 		fmt.Println("URL feeder started...")
 
-		// Send each URL to the channel
-		for i, url := range urls {
-			fmt.Printf("Feeding URL: %d/%d: %s\n", i+1, len(urls), url)
-
-			// urlChannel <- url sends the URL to the channel
-			// This will block if no one is reading from the channel (with unbuffered channels)
-			urlChannel <- url
+		for i, u := range urls {
+			fmt.Printf("Feeding URL: %d/%d: %s\n", i+1, len(urls), u)
+			seen.Set(u)
+			urlChannel <- crawlURL{url: u, depth: 0}
 		}
 
-		close(urlChannel)
-		fmt.Println("URL feeder finished - channel closed")
+		fmt.Println("URL feeder finished - seed URLs queued")
 	}()
 
 	// Start the result collector goroutine
 	// THis will collect results from workers and send them back when complete
-	go resultCollector(resultChannel, &wg, done)
-
-	// // Start a single worker goroutine
-	// // The worker will process URLs from urlChannel and send results to resultChannel
-	// go worker(1, urlChannel, resultChannel)
+	go resultCollector(ctx, resultChannel, sinks, done)
 
 	// Start multiple worker goroutines
 	// Each worker runs the same function but with a different ID for identification
-	// All workers share the same urlChannel (input) and resultChannel (output)
+	// All workers share the same urlChannel (input/output) and resultChannel (output)
 	// This creates a worker pool where work is automatically distributed
 	for i := 1; i <= numWorkers; i++ {
 		// Add 1 to WaitGroup for each worker we're about to start
@@ -232,9 +942,19 @@ func main() {
 
 		// Start the worker, passing the WaitGroup pointer
 		// Each worker will call wg.Done() when it finishes (via defer)
-		go worker(i, urlChannel, resultChannel, &wg)
+		go worker(ctx, i, urlChannel, resultChannel, seen, limits, cfg, hostLimiter, robots, &pending, &pagesScraped, &wg)
 	}
 
+	// Close urlChannel once pending work reaches zero - this is the only
+	// safe point to close it now that workers both produce and consume from
+	// it. Closing from the feeder side (as before) would race with workers
+	// still trying to enqueue discovered links.
+	go func() {
+		pending.Wait()
+		close(urlChannel)
+		fmt.Println("No more pending work - url channel closed by coordinator")
+	}()
+
 	// Add a goroutine to close the result channel when all workers finish
 	// This goroutine coordinates the workers but doesn't send data itself
 	go func() {
@@ -247,99 +967,30 @@ func main() {
 		fmt.Println("All workers finished - result channel closed by coordinator")
 	}()
 
-	// // Collect results from the worker
-	// fmt.Printf("\n=== Collecting Results from the Worker ===\n")
-	// // Create a slice to store all results
-	// // THis demonstrates collecting structured data instead of just printing
-	// var results []ScrapeResult
-
-	// for range urls {
-	// 	// Receive a result from the worker
-	// 	// This will block until a result is available
-	// 	result := <-resultChannel
-
-	// 	results = append(results, result)
-	// 	printResult(result)
-	// }
-
-	// range over a channel receives values until the channel is closed
-	// this is the idiomatic way to consume all values from a channel
-	// the loop automatically ends when the channel is closed
-	// for url := range urlChannel {
-	// 	fmt.Printf("Received URL from channel: %s\n", url)
-
-	// 	// Process the URL (same as before)
-	// 	result := scrapeURL(url)
-	// 	results = append(results, result)
-	// 	printResult(result)
-
-	// 	// Send result to result channel (we'll use this more in later steps)
-	// 	// resultChannel <- result
-	// }
-
-	// Sequential processing: scrape each URL one after another
-	// This is the "baseline" - each request waits for the previous one to complete
-	// Notice how this wil take at least 1+2+1+0+3+0+1+0 = 8+ seconds total
-	// fmt.Println("\n=== Sequential Scraping ===")
-	// for i, url := range urls {
-	// 	// The range keyword give us index (i) and value (url) for each element
-	// 	// We'll use the index to show the progress through our list
-	// 	fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(urls), url)
-
-	// 	// call scrapeURL and collect the result
-	// 	result := scrapeURL(url)
-
-	// 	// Add the result to our collection
-	// 	results = append(results, result)
-
-	// 	// Display the result immediately
-	// 	printResult(result)
-	// }
-
 	fmt.Println("\n=== Waiting for Results from Worker Pool ===")
 
-	// Block until the result collector send us the complete results
-	// This is a clean way to wai for all concurrent work to complete
-	results := <-done
+	// Block until the result collector is done. The slice it sends is only
+	// populated if the -output spec asked for a "memory" sink - the
+	// summary below reads its numbers from stats instead, so it doesn't
+	// depend on that slice being present.
+	<-done
 
 	// Calculate and display total time for sequential approach
 	// time.since() give us the elapsed time from totalStart until now
 	totalDuration := time.Since(totalStart)
 
+	count, successCount, totalProcessingTime := stats.snapshot()
+
 	// Display summary statistics
 	fmt.Printf("\n=== Worker Pool Summary ===\n")
 	fmt.Printf("Number of workers: %d\n", numWorkers)
-	fmt.Printf("Total URLs processed: %d\n", len(results))
+	fmt.Printf("Total pages crawled: %d\n", count)
 	fmt.Printf("Total time: %v\n", totalDuration)
-
-	// Calculate expected sequential time for comparison
-	// This helps us understand the speedup gained from concurrency
-	totalDelayTime := 1 + 2 + 1 + 0 + 3 + 0 + 1 + 0 // sum of httpbin delays
-	fmt.Printf("Expected sequential time: ~%ds (sum of delays)\n", totalDelayTime)
-
-	// Count successful vs failed requests
-	successCount := 0
-	for _, result := range results {
-		if result.Error == nil {
-			successCount++
-		}
-	}
 	fmt.Printf("Successful requests: %d\n", successCount)
-	fmt.Printf("Failed requests: %d\n", len(results)-successCount)
-
-	// Calculate approximate speedup
-	// Real speedup will be less than perfect due to network overhead and coordination costs
-	if totalDuration.Seconds() > 0 {
-		speedup := float64(totalDelayTime) / totalDuration.Seconds()
-		fmt.Printf("Approximate speedup: %.2fx\n", speedup)
-	}
+	fmt.Printf("Failed requests: %d\n", count-successCount)
 
 	// Additional analysis: show processing time distribution
 	fmt.Printf("\n=== Processing Time Analysis ===\n")
-	var totalProcessingTime time.Duration
-	for _, result := range results {
-		totalProcessingTime += result.Duration
-	}
 	fmt.Printf("Total processing time (sum of all requests): %v\n", totalProcessingTime)
 	fmt.Printf("Wall clock time (concurrent execution): %v\n", totalDuration)
 	parallelismEfficiency := float64(totalProcessingTime) / float64(totalDuration*time.Duration(numWorkers))